@@ -0,0 +1,185 @@
+package framework
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cacheManifest is the sidecar JSON stored alongside a cached fixture, recording
+// enough to both validate a cache hit and let reviewers pin/compare fixture
+// hashes across PRs.
+type cacheManifest struct {
+	SrcDigest string    `json:"srcDigest"`
+	Pipeline  []string  `json:"pipeline"`
+	OutDigest string    `json:"outDigest"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// cacheDir returns the content-addressable fixture cache directory configured
+// via CDI_TEST_CACHE, or "" if caching is disabled.
+func cacheDir() string {
+	return os.Getenv("CDI_TEST_CACHE")
+}
+
+// cacheKey identifies a (source, pipeline) pair: sha256(srcDigest + pipeline).
+func cacheKey(srcDigest string, pipeline []string) (string, error) {
+	h := sha256.New()
+	if _, err := io.WriteString(h, srcDigest); err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(h, strings.Join(pipeline, ":")); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func manifestPath(dir, key string) string {
+	return filepath.Join(dir, key+".json")
+}
+
+func artifactPath(dir, key string, pipeline []string) string {
+	ext := ""
+	if len(pipeline) > 0 {
+		ext = pipeline[len(pipeline)-1]
+	}
+	return filepath.Join(dir, key+ext)
+}
+
+// lookupCache returns the cached artifact for srcFile+pipeline, if present and
+// its manifest still matches the current source and output digests.
+func lookupCache(dir, srcFile string, pipeline []string) (string, bool, error) {
+	srcDigest, err := fileDigest(srcFile)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "could not digest source file %q", srcFile)
+	}
+
+	key, err := cacheKey(srcDigest, pipeline)
+	if err != nil {
+		return "", false, err
+	}
+
+	data, err := os.ReadFile(manifestPath(dir, key))
+	if err != nil {
+		return "", false, nil
+	}
+	var m cacheManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", false, nil
+	}
+	if m.SrcDigest != srcDigest {
+		return "", false, nil
+	}
+
+	tgt := artifactPath(dir, key, pipeline)
+	outDigest, err := fileDigest(tgt)
+	if err != nil || outDigest != m.OutDigest {
+		return "", false, nil
+	}
+	return tgt, true, nil
+}
+
+// storeCache records out (the result of running pipeline over srcFile) in the
+// cache, copying it to the content-addressed location and writing its manifest.
+func storeCache(dir, srcFile string, pipeline []string, out string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "could not create cache dir %q", dir)
+	}
+
+	srcDigest, err := fileDigest(srcFile)
+	if err != nil {
+		return errors.Wrapf(err, "could not digest source file %q", srcFile)
+	}
+	outDigest, err := fileDigest(out)
+	if err != nil {
+		return errors.Wrapf(err, "could not digest output file %q", out)
+	}
+
+	key, err := cacheKey(srcDigest, pipeline)
+	if err != nil {
+		return err
+	}
+
+	tgt := artifactPath(dir, key, pipeline)
+	if tgt != out {
+		if err := copyFile(out, tgt); err != nil {
+			return errors.Wrapf(err, "could not cache %q as %q", out, tgt)
+		}
+	}
+
+	m := cacheManifest{
+		SrcDigest: srcDigest,
+		Pipeline:  pipeline,
+		OutDigest: outDigest,
+		CreatedAt: time.Now().UTC(),
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal cache manifest")
+	}
+	if err := os.WriteFile(manifestPath(dir, key), data, 0644); err != nil {
+		return errors.Wrapf(err, "could not write cache manifest for %q", srcFile)
+	}
+	return nil
+}
+
+// linkOrCopy makes the cached artifact at src available at dst (a path under
+// the caller's tgtDir), hardlinking when possible and falling back to a copy
+// across filesystem boundaries. Without this, a cache hit would hand callers
+// a path inside CDI_TEST_CACHE instead of under the tgtDir they asked for,
+// breaking callers (e.g. an HTTP file server rooted at tgtDir) that expect
+// FormatTestData's result to live there.
+func linkOrCopy(src, dst string) error {
+	if di, err := os.Stat(dst); err == nil {
+		if si, err := os.Stat(src); err == nil && os.SameFile(si, di) {
+			return nil
+		}
+		// A file left at dst by an earlier run may hold another source's
+		// output; replace it rather than serve it.
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,105 @@
+package framework
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kubevirt.io/containerized-data-importer/pkg/image"
+)
+
+func decompressGz(t *testing.T, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open %q: %v", path, err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("could not open gzip reader for %q: %v", path, err)
+	}
+	defer gr.Close()
+
+	data, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("could not decompress %q: %v", path, err)
+	}
+	return data
+}
+
+func TestFormatTestDataCacheHit(t *testing.T) {
+	srcDir := t.TempDir()
+	src := filepath.Join(srcDir, "disk.img")
+	content := bytes.Repeat([]byte("cache me\n"), 512)
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatalf("could not write source fixture: %v", err)
+	}
+
+	t.Setenv("CDI_TEST_CACHE", t.TempDir())
+
+	tgtDir1 := t.TempDir()
+	out1, err := FormatTestData(src, tgtDir1, image.ExtGz)
+	if err != nil {
+		t.Fatalf("first FormatTestData call returned error: %v", err)
+	}
+	if filepath.Dir(out1) != tgtDir1 {
+		t.Fatalf("expected output under %q, got %q", tgtDir1, out1)
+	}
+	if got := decompressGz(t, out1); !bytes.Equal(got, content) {
+		t.Fatalf("first call produced wrong content")
+	}
+
+	// Second call against a fresh tgtDir must be served from the cache, but
+	// still return a path under the requested tgtDir with matching content.
+	tgtDir2 := t.TempDir()
+	out2, err := FormatTestData(src, tgtDir2, image.ExtGz)
+	if err != nil {
+		t.Fatalf("second FormatTestData call returned error: %v", err)
+	}
+	if filepath.Dir(out2) != tgtDir2 {
+		t.Fatalf("cache hit returned path outside tgtDir: %q", out2)
+	}
+	if filepath.Base(out1) != filepath.Base(out2) {
+		t.Fatalf("cache hit produced different filename: %q vs %q", out1, out2)
+	}
+	if got := decompressGz(t, out2); !bytes.Equal(got, content) {
+		t.Fatalf("cache hit produced wrong content")
+	}
+}
+
+func TestFormatTestDataCacheMiss(t *testing.T) {
+	srcDir := t.TempDir()
+	src := filepath.Join(srcDir, "disk.img")
+	if err := os.WriteFile(src, []byte("version one"), 0644); err != nil {
+		t.Fatalf("could not write source fixture: %v", err)
+	}
+
+	t.Setenv("CDI_TEST_CACHE", t.TempDir())
+
+	tgtDir := t.TempDir()
+	out, err := FormatTestData(src, tgtDir, image.ExtGz)
+	if err != nil {
+		t.Fatalf("FormatTestData returned error: %v", err)
+	}
+	if got := decompressGz(t, out); string(got) != "version one" {
+		t.Fatalf("unexpected content: %q", got)
+	}
+
+	// Changing the source must miss the cache and reconvert, not serve the
+	// stale artifact keyed to the old digest.
+	if err := os.WriteFile(src, []byte("version two"), 0644); err != nil {
+		t.Fatalf("could not rewrite source fixture: %v", err)
+	}
+	out, err = FormatTestData(src, tgtDir, image.ExtGz)
+	if err != nil {
+		t.Fatalf("FormatTestData returned error after source change: %v", err)
+	}
+	if got := decompressGz(t, out); string(got) != "version two" {
+		t.Fatalf("cache served stale content after source changed: %q", got)
+	}
+}
@@ -1,78 +1,247 @@
 package framework
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
 	"kubevirt.io/containerized-data-importer/pkg/image"
 	"path/filepath"
 )
 
-var formatTable = map[string]func(string, string) (string, error){
-	image.ExtGz:    gzCmd,
-	image.ExtXz:    xzCmd,
-	image.ExtTar:   tarCmd,
-	image.ExtQcow2: qcow2Cmd,
-	"":             noopCmd,
+// extZstd is the plain zstd extension. This belongs alongside image.ExtGz et al.
+// but pkg/image does not vendor a zstd constant yet, so it's kept local for now.
+const extZstd = ".zst"
+
+// FormatFunc converts srcFile into tgtDir, returning the path of the produced file.
+type FormatFunc func(srcFile, tgtDir string) (string, error)
+
+// Formatter produces a target artifact from a source file. FormatFunc implements
+// Formatter so plain functions can be registered without an adapter type.
+type Formatter interface {
+	Format(srcFile, tgtDir string) (string, error)
+}
+
+// Format implements Formatter.
+func (f FormatFunc) Format(srcFile, tgtDir string) (string, error) {
+	return f(srcFile, tgtDir)
+}
+
+// Compressor compresses the bytes read from src, writing the compressed stream to dst.
+// Implementations must flush/close any internal buffering before returning.
+type Compressor interface {
+	Compress(dst io.Writer, src io.Reader) error
+}
+
+// Archiver writes a single file, identified by name, into dst as an archive entry.
+type Archiver interface {
+	Archive(dst io.Writer, name string, r io.Reader, size int64) error
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(dst io.Writer, src io.Reader) error {
+	gw := gzip.NewWriter(dst)
+	if _, err := io.Copy(gw, src); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+type xzCompressor struct{}
+
+func (xzCompressor) Compress(dst io.Writer, src io.Reader) error {
+	xw, err := xz.NewWriter(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(xw, src); err != nil {
+		return err
+	}
+	return xw.Close()
+}
+
+type zstdCompressor struct{}
+
+func (zstdCompressor) Compress(dst io.Writer, src io.Reader) error {
+	zw, err := zstd.NewWriter(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, src); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+type tarArchiver struct{}
+
+func (tarArchiver) Archive(dst io.Writer, name string, r io.Reader, size int64) error {
+	tw := tar.NewWriter(dst)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+var (
+	formatMu    sync.RWMutex
+	formatTable = map[string]Formatter{
+		image.ExtGz:    FormatFunc(gzCmd),
+		image.ExtXz:    FormatFunc(xzCmd),
+		image.ExtTar:   FormatFunc(tarCmd),
+		image.ExtQcow2: FormatFunc(qcow2Cmd),
+		extZstd:        FormatFunc(zstdCmd),
+		"":             FormatFunc(noopCmd),
+	}
+)
+
+// RegisterFormat registers fn as the handler for the given target format extension,
+// overriding any existing entry. Callers may use this to add formats (e.g. bzip2)
+// without modifying this package.
+func RegisterFormat(ext string, fn FormatFunc) {
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	formatTable[ext] = fn
 }
 
 // create file based on targetFormat extensions and return created file's name.
 // note: intermediate files are removed.
+//
+// Conversions run through a Pipeline (pipeline.go), which streams chained
+// transforms via io.Pipe instead of writing every intermediate stage to
+// tgtDir.
+//
+// If CDI_TEST_CACHE is set, the result is looked up in and stored to a
+// content-addressable cache keyed on the source file's digest and the
+// pipeline of target formats, so repeated runs over the same fixture skip
+// re-running the conversion (see cache.go).
 func FormatTestData(srcFile, tgtDir string, targetFormats ...string) (string, error) {
-	var err error
-	for _, tf := range targetFormats {
-		f, ok := formatTable[tf]
-		if !ok {
-			return "", errors.Errorf("format extension %q not recognized", tf)
+	tgt := filepath.Join(tgtDir, pipelineDestName(srcFile, targetFormats))
+
+	if dir := cacheDir(); dir != "" {
+		if cached, ok, err := lookupCache(dir, srcFile, targetFormats); err != nil {
+			return "", err
+		} else if ok {
+			if err := linkOrCopy(cached, tgt); err != nil {
+				return "", errors.Wrapf(err, "could not materialize cached fixture %q into %q", cached, tgt)
+			}
+			return tgt, nil
 		}
-		// invoke conversion func
-		srcFile, err = f(srcFile, tgtDir)
-		if err != nil {
-			return "", errors.Wrap(err, "could not format test data")
+	}
+
+	pipeline, err := NewPipeline(targetFormats...)
+	if err != nil {
+		return "", err
+	}
+	if err := pipeline.Run(context.Background(), srcFile, tgt); err != nil {
+		return "", errors.Wrap(err, "could not format test data")
+	}
+
+	if dir := cacheDir(); dir != "" {
+		if err := storeCache(dir, srcFile, targetFormats, tgt); err != nil {
+			return "", err
 		}
 	}
-	return srcFile, nil
+	return tgt, nil
 }
 
-func tarCmd(src, tgtDir string) (string, error) {
-	base := filepath.Base(src)
-	tgt := filepath.Join(tgtDir, base+image.ExtTar)
-	args := []string{"-cf", tgt, src}
+// nextName applies one format stage's renaming rule to name, mirroring how
+// the corresponding FormatFunc names its own output file.
+func nextName(name, format string) string {
+	switch format {
+	case image.ExtQcow2:
+		return strings.Replace(name, ".iso", image.ExtQcow2, 1)
+	case "":
+		return name
+	default:
+		return name + format
+	}
+}
 
-	if err := doCmdAndVerifyFile(tgt, "tar", args...); err != nil {
-		return "", err
+// pipelineDestName computes the filename FormatTestData/Pipeline will produce
+// for srcFile after running through targetFormats in order.
+func pipelineDestName(srcFile string, targetFormats []string) string {
+	name := filepath.Base(srcFile)
+	for _, f := range targetFormats {
+		name = nextName(name, f)
 	}
-	return tgt, nil
+	return name
 }
 
-func gzCmd(src, tgtDir string) (string, error) {
-	src, err := copyIfNotPresent(src, tgtDir)
+func tarCmd(src, tgtDir string) (string, error) {
+	in, err := os.Open(src)
 	if err != nil {
-		return "", err
+		return "", errors.Wrapf(err, "could not open source file %q", src)
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return "", errors.Wrapf(err, "could not stat source file %q", src)
 	}
+
 	base := filepath.Base(src)
-	tgt := filepath.Join(tgtDir, base+image.ExtGz)
-	if err := doCmdAndVerifyFile(tgt, "gzip", src); err != nil {
-		return "", err
+	tgt := filepath.Join(tgtDir, base+image.ExtTar)
+	out, err := os.Create(tgt)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not create target file %q", tgt)
+	}
+	defer out.Close()
+
+	if err := (tarArchiver{}).Archive(out, base, in, fi.Size()); err != nil {
+		os.Remove(tgt)
+		return "", errors.Wrapf(err, "could not archive %q", src)
 	}
 	return tgt, nil
 }
 
+func gzCmd(src, tgtDir string) (string, error) {
+	return compressCmd(src, tgtDir, image.ExtGz, gzipCompressor{})
+}
+
 func xzCmd(src, tgtDir string) (string, error) {
-	src, err := copyIfNotPresent(src, tgtDir)
+	return compressCmd(src, tgtDir, image.ExtXz, xzCompressor{})
+}
+
+func zstdCmd(src, tgtDir string) (string, error) {
+	return compressCmd(src, tgtDir, extZstd, zstdCompressor{})
+}
+
+func compressCmd(src, tgtDir, ext string, c Compressor) (string, error) {
+	in, err := os.Open(src)
 	if err != nil {
-		return "", err
+		return "", errors.Wrapf(err, "could not open source file %q", src)
 	}
+	defer in.Close()
+
 	base := filepath.Base(src)
-	tgt := filepath.Join(tgtDir, base+image.ExtXz)
-	if err := doCmdAndVerifyFile(tgt, "xz", src); err != nil {
-		return "", err
+	tgt := filepath.Join(tgtDir, base+ext)
+	out, err := os.Create(tgt)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not create target file %q", tgt)
+	}
+	defer out.Close()
+
+	if err := c.Compress(out, in); err != nil {
+		os.Remove(tgt)
+		return "", errors.Wrapf(err, "could not compress %q", src)
 	}
 	return tgt, nil
 }
 
+// qcow2Cmd has no pure-Go equivalent available, so it continues to shell out to qemu-img.
 func qcow2Cmd(srcfile, tgtDir string) (string, error) {
 	tgt := strings.Replace(filepath.Base(srcfile), ".iso", image.ExtQcow2, 1)
 	tgt = filepath.Join(tgtDir, tgt)
@@ -0,0 +1,60 @@
+package framework
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// FormatTestDataGlob expands pattern (via filepath.Glob) into one or more source
+// files and runs each through FormatTestData, returning the list of produced
+// files in the order their sources were matched.
+func FormatTestDataGlob(pattern, tgtDir string, targetFormats ...string) ([]string, error) {
+	srcs, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not expand glob %q", pattern)
+	}
+	if len(srcs) == 0 {
+		return nil, errors.Errorf("glob %q matched no files", pattern)
+	}
+
+	out := make([]string, 0, len(srcs))
+	for _, src := range srcs {
+		tgt, err := FormatTestData(src, tgtDir, targetFormats...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not format %q", src)
+		}
+		out = append(out, tgt)
+	}
+	return out, nil
+}
+
+// ChecksumWildcard expands pattern and returns the SHA256 digest of each matched
+// file, keyed by path. It lets tests assert that fixture generation is
+// deterministic across CI runs.
+func ChecksumWildcard(pattern string) (map[string]digest.Digest, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not expand glob %q", pattern)
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("glob %q matched no files", pattern)
+	}
+
+	sums := make(map[string]digest.Digest, len(paths))
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not open %q", p)
+		}
+		d, err := digest.SHA256.FromReader(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not checksum %q", p)
+		}
+		sums[p] = d
+	}
+	return sums, nil
+}
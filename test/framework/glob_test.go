@@ -0,0 +1,102 @@
+package framework
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"kubevirt.io/containerized-data-importer/pkg/image"
+)
+
+func writeFixtures(t *testing.T, dir string, names ...string) []string {
+	t.Helper()
+	var paths []string
+	for i, name := range names {
+		p := filepath.Join(dir, name)
+		content := []byte(strings.Repeat("x", i+1))
+		if err := os.WriteFile(p, content, 0644); err != nil {
+			t.Fatalf("could not write fixture %q: %v", p, err)
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+func TestFormatTestDataGlob(t *testing.T) {
+	srcDir := t.TempDir()
+	tgtDir := t.TempDir()
+	writeFixtures(t, srcDir, "a.img", "b.img", "c.img")
+
+	out, err := FormatTestDataGlob(filepath.Join(srcDir, "*.img"), tgtDir, image.ExtGz)
+	if err != nil {
+		t.Fatalf("FormatTestDataGlob returned error: %v", err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("expected 3 produced files, got %d: %v", len(out), out)
+	}
+	for _, p := range out {
+		if filepath.Dir(p) != tgtDir {
+			t.Errorf("produced file %q not under tgtDir %q", p, tgtDir)
+		}
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("produced file %q does not exist: %v", p, err)
+		}
+	}
+
+	names := make([]string, len(out))
+	for i, p := range out {
+		names[i] = filepath.Base(p)
+	}
+	want := []string{"a.img" + image.ExtGz, "b.img" + image.ExtGz, "c.img" + image.ExtGz}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("produced files = %v, want %v (glob match order)", names, want)
+	}
+}
+
+func TestFormatTestDataGlobNoMatch(t *testing.T) {
+	if _, err := FormatTestDataGlob(filepath.Join(t.TempDir(), "*.nope"), t.TempDir()); err == nil {
+		t.Fatal("expected an error when the glob matches nothing")
+	}
+}
+
+func TestChecksumWildcardDeterministic(t *testing.T) {
+	srcDir := t.TempDir()
+	writeFixtures(t, srcDir, "a.img", "b.img")
+	pattern := filepath.Join(srcDir, "*.img")
+
+	first, err := ChecksumWildcard(pattern)
+	if err != nil {
+		t.Fatalf("ChecksumWildcard returned error: %v", err)
+	}
+	second, err := ChecksumWildcard(pattern)
+	if err != nil {
+		t.Fatalf("ChecksumWildcard returned error: %v", err)
+	}
+
+	if len(first) != 2 {
+		t.Fatalf("expected 2 digests, got %d", len(first))
+	}
+	for path, d := range first {
+		if second[path] != d {
+			t.Errorf("digest for %q not stable across runs: %q vs %q", path, d, second[path])
+		}
+	}
+
+	var paths []string
+	for p := range first {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if first[paths[0]] == first[paths[1]] {
+		t.Errorf("expected distinct fixtures to produce distinct digests")
+	}
+}
+
+func TestChecksumWildcardNoMatch(t *testing.T) {
+	if _, err := ChecksumWildcard(filepath.Join(t.TempDir(), "*.nope")); err == nil {
+		t.Fatal("expected an error when the glob matches nothing")
+	}
+}
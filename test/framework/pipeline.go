@@ -0,0 +1,269 @@
+package framework
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"kubevirt.io/containerized-data-importer/pkg/image"
+)
+
+// stageFunc runs one pipeline stage, reading src and writing the transformed
+// result to dst, and returns the number of bytes written.
+type stageFunc func(ctx context.Context, dst io.Writer, src io.Reader) (int64, error)
+
+// streamStages holds the formats that can run as genuine io.Reader/io.Writer
+// stages. image.ExtTar is deliberately absent: it needs the current pipeline
+// name to label its archive entry, so Run constructs it per-stage instead.
+// Anything else not listed here falls back to fileShimStage, which spools
+// through a temp file so legacy, file-based FormatFunc entries (e.g. qcow2Cmd,
+// or anything registered via RegisterFormat) keep working unchanged.
+var streamStages = map[string]stageFunc{
+	image.ExtGz: compressStreamStage(gzipCompressor{}),
+	image.ExtXz: compressStreamStage(xzCompressor{}),
+	extZstd:     compressStreamStage(zstdCompressor{}),
+}
+
+// ProgressFunc is called as each pipeline stage finishes, reporting the number
+// of bytes it wrote.
+type ProgressFunc func(stage string, bytesWritten int64)
+
+// Pipeline runs a chain of target formats as connected io.Reader/io.Writer
+// stages joined by io.Pipe, so only the final artifact is written to disk.
+// This avoids the scratch space and wall-time cost of materializing every
+// intermediate stage in tgtDir. FormatTestData runs its conversions through a
+// Pipeline.
+type Pipeline struct {
+	formats []string
+
+	mu       sync.Mutex
+	Progress ProgressFunc
+}
+
+// NewPipeline builds a Pipeline for the given chain of target format
+// extensions, validating that each is registered in formatTable.
+func NewPipeline(formats ...string) (*Pipeline, error) {
+	for _, f := range formats {
+		formatMu.RLock()
+		_, ok := formatTable[f]
+		formatMu.RUnlock()
+		if !ok {
+			return nil, errors.Errorf("format extension %q not recognized", f)
+		}
+	}
+	return &Pipeline{formats: formats}, nil
+}
+
+// Run streams src through each configured stage in turn, writing the final
+// result to dstPath. It stops as soon as ctx is done.
+func (p *Pipeline) Run(ctx context.Context, src, dstPath string) error {
+	if len(p.formats) == 0 {
+		return copyFile(src, dstPath)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "could not open source file %q", src)
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	var pipes []*io.PipeReader
+	var wg sync.WaitGroup
+	abort := func(cause error) {
+		for _, pr := range pipes {
+			pr.CloseWithError(cause)
+		}
+		wg.Wait()
+	}
+
+	name := filepath.Base(src)
+	for i, f := range p.formats {
+		stage := p.stageFor(f, name)
+		name = nextName(name, f)
+		last := i == len(p.formats)-1
+
+		if last {
+			out, err := os.Create(dstPath)
+			if err != nil {
+				abort(err)
+				return errors.Wrapf(err, "could not create target file %q", dstPath)
+			}
+			n, err := stage(ctx, out, r)
+			out.Close()
+			if err != nil {
+				os.Remove(dstPath)
+				abort(err)
+				return errors.Wrapf(err, "pipeline stage %q failed", f)
+			}
+			p.report(f, n)
+			wg.Wait()
+			return nil
+		}
+
+		pr, pw := io.Pipe()
+		pipes = append(pipes, pr)
+		wg.Add(1)
+		go func(stage stageFunc, name string, w *io.PipeWriter, r io.Reader) {
+			defer wg.Done()
+			n, err := stage(ctx, w, r)
+			if err != nil {
+				w.CloseWithError(err)
+				return
+			}
+			w.Close()
+			p.report(name, n)
+		}(stage, f, pw, r)
+
+		r = pr
+	}
+	return nil
+}
+
+func (p *Pipeline) report(stage string, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Progress != nil {
+		p.Progress(stage, n)
+	}
+}
+
+// stageFor resolves the stage for ext. name is the pipeline's current logical
+// filename (i.e. src's basename with every prior format's extension already
+// applied), used to label tar archive entries the same way tarCmd does.
+func (p *Pipeline) stageFor(ext, name string) stageFunc {
+	if ext == image.ExtTar {
+		return tarStreamStage(name)
+	}
+	if s, ok := streamStages[ext]; ok {
+		return s
+	}
+	return fileShimStage(ext)
+}
+
+// ctxReader aborts reads once ctx is done, giving non-context-aware stages
+// (e.g. a Compressor backed by io.Copy) a way to observe cancellation.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func compressStreamStage(c Compressor) stageFunc {
+	return func(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+		cw := &countWriter{w: dst}
+		if err := c.Compress(cw, ctxReader{ctx, src}); err != nil {
+			return cw.n, err
+		}
+		return cw.n, nil
+	}
+}
+
+// tarStreamStage spools src to a temp file first: tar headers require a known
+// size up front, which a mid-pipeline stream can't provide otherwise. Only
+// this one spool file touches disk, not a full intermediate artifact per stage.
+// The archive entry is named after the pipeline's current logical filename,
+// matching tarCmd's convention so a fixture's entry name doesn't depend on
+// whether it went through FormatTestData or a Pipeline.
+func tarStreamStage(name string) stageFunc {
+	return func(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+		tmp, err := os.CreateTemp("", "cdi-pipeline-tar-*")
+		if err != nil {
+			return 0, err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if _, err := io.Copy(tmp, ctxReader{ctx, src}); err != nil {
+			return 0, err
+		}
+		fi, err := tmp.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+
+		cw := &countWriter{w: dst}
+		if err := (tarArchiver{}).Archive(cw, name, tmp, fi.Size()); err != nil {
+			return cw.n, err
+		}
+		return cw.n, nil
+	}
+}
+
+// fileShimStage adapts a file-based Formatter (anything in formatTable that
+// isn't a streamStages entry, e.g. qcow2Cmd or a custom RegisterFormat entry)
+// to the stageFunc shape, so it keeps working unchanged inside a Pipeline.
+func fileShimStage(ext string) stageFunc {
+	return func(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+		formatMu.RLock()
+		formatter, ok := formatTable[ext]
+		formatMu.RUnlock()
+		if !ok {
+			return 0, errors.Errorf("format extension %q not recognized", ext)
+		}
+
+		tmpDir, err := os.MkdirTemp("", "cdi-pipeline-shim-")
+		if err != nil {
+			return 0, err
+		}
+		defer os.RemoveAll(tmpDir)
+
+		// Spool the input into its own subdirectory so a formatter that names
+		// its output after its input (e.g. qcow2Cmd on a non-.iso name) can't
+		// write over it in tmpDir.
+		srcDir := filepath.Join(tmpDir, "src")
+		if err := os.Mkdir(srcDir, 0755); err != nil {
+			return 0, err
+		}
+		in := filepath.Join(srcDir, "in")
+		inFile, err := os.Create(in)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := io.Copy(inFile, ctxReader{ctx, src}); err != nil {
+			inFile.Close()
+			return 0, err
+		}
+		inFile.Close()
+
+		out, err := formatter.Format(in, tmpDir)
+		if err != nil {
+			return 0, err
+		}
+
+		outFile, err := os.Open(out)
+		if err != nil {
+			return 0, err
+		}
+		defer outFile.Close()
+
+		cw := &countWriter{w: dst}
+		if _, err := io.Copy(cw, outFile); err != nil {
+			return cw.n, err
+		}
+		return cw.n, nil
+	}
+}
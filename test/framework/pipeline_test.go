@@ -0,0 +1,109 @@
+package framework
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kubevirt.io/containerized-data-importer/pkg/image"
+)
+
+func TestPipelineRoundTrip(t *testing.T) {
+	srcDir := t.TempDir()
+	tgtDir := t.TempDir()
+
+	content := bytes.Repeat([]byte("cdi pipeline fixture\n"), 2048)
+	src := filepath.Join(srcDir, "disk.img")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatalf("could not write source fixture: %v", err)
+	}
+
+	p, err := NewPipeline(image.ExtGz, image.ExtTar)
+	if err != nil {
+		t.Fatalf("NewPipeline returned error: %v", err)
+	}
+
+	var reported []string
+	p.Progress = func(stage string, n int64) {
+		reported = append(reported, stage)
+		if n <= 0 {
+			t.Errorf("stage %q reported non-positive byte count %d", stage, n)
+		}
+	}
+
+	dst := filepath.Join(tgtDir, "out.tar")
+	if err := p.Run(context.Background(), src, dst); err != nil {
+		t.Fatalf("Pipeline.Run returned error: %v", err)
+	}
+
+	if len(reported) != 2 {
+		t.Fatalf("expected progress for 2 stages, got %v", reported)
+	}
+	seen := map[string]bool{}
+	for _, s := range reported {
+		seen[s] = true
+	}
+	if !seen[image.ExtGz] || !seen[image.ExtTar] {
+		t.Errorf("expected progress for %q and %q, got %v", image.ExtGz, image.ExtTar, reported)
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		t.Fatalf("could not open %q: %v", dst, err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatalf("could not read tar entry: %v", err)
+	}
+	if want := "disk.img" + image.ExtGz; hdr.Name != want {
+		t.Errorf("tar entry name = %q, want %q", hdr.Name, want)
+	}
+
+	gr, err := gzip.NewReader(tr)
+	if err != nil {
+		t.Fatalf("could not open gzip reader for tar entry: %v", err)
+	}
+	defer gr.Close()
+
+	got, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("could not decompress tar entry: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("pipeline round-trip produced wrong content")
+	}
+}
+
+func TestPipelineRunRespectsCancellation(t *testing.T) {
+	srcDir := t.TempDir()
+	tgtDir := t.TempDir()
+
+	src := filepath.Join(srcDir, "disk.img")
+	if err := os.WriteFile(src, []byte("some data"), 0644); err != nil {
+		t.Fatalf("could not write source fixture: %v", err)
+	}
+
+	p, err := NewPipeline(image.ExtGz)
+	if err != nil {
+		t.Fatalf("NewPipeline returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dst := filepath.Join(tgtDir, "out.gz")
+	if err := p.Run(ctx, src, dst); err == nil {
+		t.Fatal("expected Pipeline.Run to fail against a canceled context")
+	}
+	if _, err := os.Stat(dst); err == nil {
+		t.Errorf("expected %q to be cleaned up after a canceled run", dst)
+	}
+}
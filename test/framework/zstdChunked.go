@@ -0,0 +1,149 @@
+package framework
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// zstdSkippableFrameMagic is the first of the sixteen reserved zstd skippable
+// frame magic numbers (0x184D2A50-0x184D2A5F). A conformant zstd decoder
+// skips frames carrying this magic, so the TOC can ride inside an otherwise
+// ordinary .zst stream.
+const zstdSkippableFrameMagic uint32 = 0x184D2A50
+
+// ZstdChunkedEntry describes one file within a zstd:chunked stream, as recorded
+// in the trailing table-of-contents (TOC) frame. Offset is where the entry's
+// compressed data starts in the stream; Size and Digest describe the entry's
+// uncompressed content.
+type ZstdChunkedEntry struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// ZstdChunkedManifest is the JSON TOC appended as a skippable frame at the end of
+// a zstd:chunked stream. It lets a consumer fetch only the byte ranges it needs
+// (e.g. via HTTP Range requests) instead of reading the whole blob.
+//
+// Scope: this file only covers the fixture side - writing a TOC-bearing .zst
+// stream (WriteZstdChunked/FormatTestDataZstdChunked) and reading the TOC
+// back (ReadZstdChunkedManifest). The Range-request consumer implied above
+// would live in pkg/importer, which isn't part of this checkout, so fixtures
+// produced here have no in-repo consumer yet.
+type ZstdChunkedManifest struct {
+	Entries []ZstdChunkedEntry `json:"entries"`
+}
+
+// ParseZstdChunkedManifest decodes a TOC manifest previously produced alongside a
+// zstd:chunked fixture.
+func ParseZstdChunkedManifest(data []byte) (*ZstdChunkedManifest, error) {
+	var m ZstdChunkedManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errors.Wrap(err, "could not parse zstd:chunked manifest")
+	}
+	return &m, nil
+}
+
+// WriteZstdChunked compresses src as a single zstd:chunked entry named name,
+// writing the compressed stream to dst followed by a skippable TOC frame
+// describing that entry, and returns the manifest it wrote.
+func WriteZstdChunked(dst io.Writer, src io.Reader, name string) (*ZstdChunkedManifest, error) {
+	h := sha256.New()
+	size := &countWriter{w: io.Discard}
+	tee := io.TeeReader(src, io.MultiWriter(h, size))
+
+	if err := (zstdCompressor{}).Compress(dst, tee); err != nil {
+		return nil, errors.Wrap(err, "could not compress zstd:chunked entry")
+	}
+
+	manifest := &ZstdChunkedManifest{
+		Entries: []ZstdChunkedEntry{{
+			Name:   name,
+			Offset: 0,
+			Size:   size.n,
+			Digest: "sha256:" + hex.EncodeToString(h.Sum(nil)),
+		}},
+	}
+
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal zstd:chunked manifest")
+	}
+	if err := writeZstdSkippableFrame(dst, payload); err != nil {
+		return nil, errors.Wrap(err, "could not write zstd:chunked TOC frame")
+	}
+	return manifest, nil
+}
+
+// FormatTestDataZstdChunked produces a zstd:chunked fixture from srcFile in
+// tgtDir, returning the fixture's path and the TOC manifest it was written
+// with.
+func FormatTestDataZstdChunked(srcFile, tgtDir string) (string, *ZstdChunkedManifest, error) {
+	in, err := os.Open(srcFile)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "could not open source file %q", srcFile)
+	}
+	defer in.Close()
+
+	tgt := filepath.Join(tgtDir, filepath.Base(srcFile)+extZstd)
+	out, err := os.Create(tgt)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "could not create target file %q", tgt)
+	}
+	defer out.Close()
+
+	m, err := WriteZstdChunked(out, in, filepath.Base(srcFile))
+	if err != nil {
+		os.Remove(tgt)
+		return "", nil, errors.Wrapf(err, "could not write zstd:chunked fixture for %q", srcFile)
+	}
+	return tgt, m, nil
+}
+
+// ReadZstdChunkedManifest reads the trailing TOC frame from a zstd:chunked
+// fixture previously produced by WriteZstdChunked/FormatTestDataZstdChunked.
+// The frame carries no back-pointer of its own (that would not be a valid
+// part of the zstd format), so it's located by scanning backward from EOF for
+// a skippable-frame header whose declared length reaches exactly the end of
+// the file.
+func ReadZstdChunkedManifest(path string) (*ZstdChunkedManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read %q", path)
+	}
+
+	for i := len(data) - 8; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(data[i:i+4]) != zstdSkippableFrameMagic {
+			continue
+		}
+		length := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		if i+8+length == len(data) {
+			return ParseZstdChunkedManifest(data[i+8 : i+8+length])
+		}
+	}
+	return nil, errors.Errorf("%q does not end in a zstd:chunked TOC frame", path)
+}
+
+// writeZstdSkippableFrame writes payload as a standard zstd skippable frame:
+// a 4-byte magic, a 4-byte little-endian payload length, then the payload
+// itself. Nothing follows it - appending anything else here would make the
+// stream invalid, since a conformant decoder reading to EOF expects either
+// another zstd/skippable frame header or end of input right after it.
+func writeZstdSkippableFrame(dst io.Writer, payload []byte) error {
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], zstdSkippableFrameMagic)
+	binary.LittleEndian.PutUint32(hdr[4:8], uint32(len(payload)))
+	if _, err := dst.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := dst.Write(payload)
+	return err
+}
@@ -0,0 +1,78 @@
+package framework
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestZstdChunkedRoundTrip(t *testing.T) {
+	srcDir := t.TempDir()
+	tgtDir := t.TempDir()
+
+	content := bytes.Repeat([]byte("cdi zstd:chunked fixture\n"), 1024)
+	srcFile := filepath.Join(srcDir, "disk.img")
+	if err := os.WriteFile(srcFile, content, 0644); err != nil {
+		t.Fatalf("could not write source fixture: %v", err)
+	}
+
+	tgt, written, err := FormatTestDataZstdChunked(srcFile, tgtDir)
+	if err != nil {
+		t.Fatalf("FormatTestDataZstdChunked returned error: %v", err)
+	}
+
+	read, err := ReadZstdChunkedManifest(tgt)
+	if err != nil {
+		t.Fatalf("ReadZstdChunkedManifest returned error: %v", err)
+	}
+	if !reflect.DeepEqual(written, read) {
+		t.Fatalf("manifest round-trip mismatch: wrote %+v, read %+v", written, read)
+	}
+
+	if len(read.Entries) != 1 {
+		t.Fatalf("expected 1 TOC entry, got %d", len(read.Entries))
+	}
+	entry := read.Entries[0]
+	if entry.Name != filepath.Base(srcFile) {
+		t.Errorf("entry name = %q, want %q", entry.Name, filepath.Base(srcFile))
+	}
+	if entry.Size != int64(len(content)) {
+		t.Errorf("entry size = %d, want %d", entry.Size, len(content))
+	}
+
+	// The produced file must be a valid zstd stream end to end: a plain
+	// io.ReadAll/io.Copy consumer (one that has no idea about the trailing
+	// TOC frame) must be able to read it to completion without the decoder
+	// erroring out on the skippable frame.
+	f, err := os.Open(tgt)
+	if err != nil {
+		t.Fatalf("could not open %q: %v", tgt, err)
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatalf("could not open zstd reader: %v", err)
+	}
+	defer zr.Close()
+
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("could not decompress full stream: %v", err)
+	}
+
+	sum := sha256.Sum256(got)
+	if gotDigest := "sha256:" + hex.EncodeToString(sum[:]); gotDigest != entry.Digest {
+		t.Errorf("decompressed digest = %q, want %q", gotDigest, entry.Digest)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("decompressed content does not match source")
+	}
+}